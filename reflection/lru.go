@@ -0,0 +1,68 @@
+package reflection
+
+import "container/list"
+
+// lru is a fixed-capacity, least-recently-used cache keyed and valued by
+// interface{}. It is not safe for concurrent use; callers serialize access
+// themselves (see serverReflectionServer.mu). A capacity of 0 means
+// unbounded.
+type lru struct {
+	capacity int
+	ll       *list.List
+	items    map[interface{}]*list.Element
+}
+
+type lruEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[interface{}]*list.Element),
+	}
+}
+
+// peek looks up key without updating recency, so it is safe to call with
+// only a read lock held: unlike get, it never mutates the backing list.
+func (c *lru) peek(key interface{}) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(*lruEntry).value, true
+}
+
+// get looks up key and, on a hit, marks it most-recently-used. Callers must
+// hold the exclusive lock: moving the list element is a mutation.
+func (c *lru) get(key interface{}) (interface{}, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lru) add(key, value interface{}) {
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	if c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeOldest()
+	}
+}
+
+func (c *lru) removeOldest() {
+	e := c.ll.Back()
+	if e == nil {
+		return
+	}
+	c.ll.Remove(e)
+	delete(c.items, e.Value.(*lruEntry).key)
+}
@@ -0,0 +1,148 @@
+package reflection
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// TestServerReflectionInfoExtraSourceSymbol checks that FileContainingSymbol
+// resolves a symbol that exists only in an extra DescriptorSource, not the
+// process-global protobuf registry or the server's own method metadata.
+func TestServerReflectionInfoExtraSourceSymbol(t *testing.T) {
+	fd := &dpb.FileDescriptorProto{Name: proto.String("dynamic.proto")}
+	srv := &serverReflectionServer{
+		s:                 grpc.NewServer(),
+		typeToNameMap:     newLRU(defaultCacheSize),
+		nameToTypeMap:     newLRU(defaultCacheSize),
+		typeToFileDescMap: newLRU(defaultCacheSize),
+		extraSources: []DescriptorSource{&fakeDescriptorSource{
+			symbols: map[string]*dpb.FileDescriptorProto{"dynamic.Foo": fd},
+		}},
+	}
+
+	reqs := make(chan *rpb.ServerReflectionRequest, 1)
+	reqs <- &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "dynamic.Foo"},
+	}
+	close(reqs)
+
+	var got *rpb.ServerReflectionResponse
+	stream := &fakeServerReflectionInfoStream{
+		reqs: reqs,
+		send: func(resp *rpb.ServerReflectionResponse) error {
+			got = resp
+			return nil
+		},
+	}
+	if err := srv.ServerReflectionInfo(stream); err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+
+	fdr := got.GetFileDescriptorResponse()
+	if fdr == nil || len(fdr.GetFileDescriptorProto()) != 1 {
+		t.Fatalf("got %+v, want a single-file FileDescriptorResponse", got)
+	}
+	got1 := new(dpb.FileDescriptorProto)
+	if err := proto.Unmarshal(fdr.GetFileDescriptorProto()[0], got1); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got1.GetName() != "dynamic.proto" {
+		t.Errorf("file name = %q, want %q", got1.GetName(), "dynamic.proto")
+	}
+}
+
+// TestServerReflectionInfoExtraSourceExtension checks that
+// FileContainingExtension resolves an extension that exists only in an
+// extra DescriptorSource.
+func TestServerReflectionInfoExtraSourceExtension(t *testing.T) {
+	fd := &dpb.FileDescriptorProto{Name: proto.String("dynamic_ext.proto")}
+	srv := &serverReflectionServer{
+		s:                 grpc.NewServer(),
+		typeToNameMap:     newLRU(defaultCacheSize),
+		nameToTypeMap:     newLRU(defaultCacheSize),
+		typeToFileDescMap: newLRU(defaultCacheSize),
+		extraSources: []DescriptorSource{&fakeDescriptorSource{
+			extensions: map[string]*dpb.FileDescriptorProto{"dynamic.Foo:7": fd},
+		}},
+	}
+
+	reqs := make(chan *rpb.ServerReflectionRequest, 1)
+	reqs <- &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingExtension{
+			FileContainingExtension: &rpb.ExtensionRequest{ContainingType: "dynamic.Foo", ExtensionNumber: 7},
+		},
+	}
+	close(reqs)
+
+	var got *rpb.ServerReflectionResponse
+	stream := &fakeServerReflectionInfoStream{
+		reqs: reqs,
+		send: func(resp *rpb.ServerReflectionResponse) error {
+			got = resp
+			return nil
+		},
+	}
+	if err := srv.ServerReflectionInfo(stream); err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+
+	fdr := got.GetFileDescriptorResponse()
+	if fdr == nil || len(fdr.GetFileDescriptorProto()) != 1 {
+		t.Fatalf("got %+v, want a single-file FileDescriptorResponse", got)
+	}
+	got1 := new(dpb.FileDescriptorProto)
+	if err := proto.Unmarshal(fdr.GetFileDescriptorProto()[0], got1); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got1.GetName() != "dynamic_ext.proto" {
+		t.Errorf("file name = %q, want %q", got1.GetName(), "dynamic_ext.proto")
+	}
+}
+
+// TestServerReflectionInfoExtraSourceExtensionNumbers checks that
+// AllExtensionNumbersOfType resolves a type that exists only in an extra
+// DescriptorSource.
+func TestServerReflectionInfoExtraSourceExtensionNumbers(t *testing.T) {
+	srv := &serverReflectionServer{
+		s:                 grpc.NewServer(),
+		typeToNameMap:     newLRU(defaultCacheSize),
+		nameToTypeMap:     newLRU(defaultCacheSize),
+		typeToFileDescMap: newLRU(defaultCacheSize),
+		extraSources: []DescriptorSource{&fakeDescriptorSource{
+			extNums: map[string][]int32{"dynamic.Foo": {3, 7, 9}},
+		}},
+	}
+
+	reqs := make(chan *rpb.ServerReflectionRequest, 1)
+	reqs <- &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_AllExtensionNumbersOfType{AllExtensionNumbersOfType: "dynamic.Foo"},
+	}
+	close(reqs)
+
+	var got *rpb.ServerReflectionResponse
+	stream := &fakeServerReflectionInfoStream{
+		reqs: reqs,
+		send: func(resp *rpb.ServerReflectionResponse) error {
+			got = resp
+			return nil
+		},
+	}
+	if err := srv.ServerReflectionInfo(stream); err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+
+	nums := got.GetAllExtensionNumbersResponse().GetExtensionNumber()
+	want := []int32{3, 7, 9}
+	if len(nums) != len(want) {
+		t.Fatalf("ExtensionNumber = %v, want %v", nums, want)
+	}
+	for i := range want {
+		if nums[i] != want[i] {
+			t.Errorf("ExtensionNumber[%d] = %d, want %d", i, nums[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package reflection
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// TestRegisterEndToEnd exercises the public Register entry point (the one
+// InstallOnServer delegates to) over a real, if in-memory, connection: it
+// checks that both the v1 and v1alpha reflection services come up, and that
+// a WithDescriptorSource option actually changes what the running server
+// resolves.
+func TestRegisterEndToEnd(t *testing.T) {
+	fd := &dpb.FileDescriptorProto{Name: proto.String("dynamic.proto")}
+	s := grpc.NewServer()
+	Register(s, WithDescriptorSource(&fakeDescriptorSource{
+		symbols: map[string]*dpb.FileDescriptorProto{"dynamic.Foo": fd},
+	}))
+
+	info := s.GetServiceInfo()
+	for _, name := range []string{
+		"grpc.reflection.v1alpha.ServerReflection",
+		"grpc.reflection.v1.ServerReflection",
+	} {
+		if _, ok := info[name]; !ok {
+			t.Errorf("Register didn't register %s", name)
+		}
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer cc.Close()
+
+	stream, err := rpb.NewServerReflectionClient(cc).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+	if err := stream.Send(&rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "dynamic.Foo"},
+	}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	fdr := resp.GetFileDescriptorResponse()
+	if fdr == nil || len(fdr.GetFileDescriptorProto()) != 1 {
+		t.Fatalf("got %+v, want a single-file FileDescriptorResponse", resp)
+	}
+	got := new(dpb.FileDescriptorProto)
+	if err := proto.Unmarshal(fdr.GetFileDescriptorProto()[0], got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.GetName() != "dynamic.proto" {
+		t.Errorf("file name = %q, want %q", got.GetName(), "dynamic.proto")
+	}
+}
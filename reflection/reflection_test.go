@@ -0,0 +1,141 @@
+package reflection
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/grpc"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// TestListServicesSorted checks that ListServices returns every registered
+// service, sorted by name regardless of registration order.
+func TestListServicesSorted(t *testing.T) {
+	s := grpc.NewServer()
+	for _, name := range []string{"test.Second", "test.First"} {
+		s.RegisterService(&grpc.ServiceDesc{
+			ServiceName: name,
+			HandlerType: (*interface{})(nil),
+		}, nil)
+	}
+	srv := &serverReflectionServer{s: s}
+
+	reqs := make(chan *rpb.ServerReflectionRequest, 1)
+	reqs <- &rpb.ServerReflectionRequest{MessageRequest: &rpb.ServerReflectionRequest_ListServices{}}
+	close(reqs)
+
+	var got *rpb.ListServiceResponse
+	stream := &fakeServerReflectionInfoStream{
+		reqs: reqs,
+		send: func(resp *rpb.ServerReflectionResponse) error {
+			got = resp.GetListServicesResponse()
+			return nil
+		},
+	}
+	if err := srv.ServerReflectionInfo(stream); err != nil {
+		t.Fatalf("ServerReflectionInfo: %v", err)
+	}
+
+	var names []string
+	for _, svc := range got.GetService() {
+		names = append(names, svc.GetName())
+	}
+	want := []string{"test.First", "test.Second"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("ListServices() = %v, want %v", names, want)
+	}
+}
+
+// fakeDescriptorSource serves file descriptors and extension numbers from
+// in-memory maps, for exercising DescriptorSource fallback without
+// depending on the process-global protobuf registry. Unset maps behave as
+// if the source has nothing to offer for that lookup kind.
+type fakeDescriptorSource struct {
+	files      map[string]*dpb.FileDescriptorProto
+	symbols    map[string]*dpb.FileDescriptorProto
+	extensions map[string]*dpb.FileDescriptorProto // keyed by fmt.Sprintf("%s:%d", msg, field)
+	extNums    map[string][]int32
+}
+
+func (f *fakeDescriptorSource) FindFileByName(name string) (*dpb.FileDescriptorProto, error) {
+	if fd, ok := f.files[name]; ok {
+		return fd, nil
+	}
+	return nil, fmt.Errorf("not found: %s", name)
+}
+
+func (f *fakeDescriptorSource) FindSymbol(name string) (*dpb.FileDescriptorProto, error) {
+	if fd, ok := f.symbols[name]; ok {
+		return fd, nil
+	}
+	return nil, fmt.Errorf("not found: %s", name)
+}
+
+func (f *fakeDescriptorSource) FindExtension(msg string, field int32) (*dpb.FileDescriptorProto, error) {
+	if fd, ok := f.extensions[fmt.Sprintf("%s:%d", msg, field)]; ok {
+		return fd, nil
+	}
+	return nil, fmt.Errorf("not found: %s:%d", msg, field)
+}
+
+func (f *fakeDescriptorSource) AllExtensionNumbersForType(msg string) ([]int32, error) {
+	if nums, ok := f.extNums[msg]; ok {
+		return nums, nil
+	}
+	return nil, fmt.Errorf("not found: %s", msg)
+}
+
+// TestAllFileDescriptorsDedupesAndOrders checks that the transitive closure
+// of a file's dependencies comes back with each file exactly once, in
+// dependency order (imports before importers).
+func TestAllFileDescriptorsDedupesAndOrders(t *testing.T) {
+	a := &dpb.FileDescriptorProto{Name: proto.String("a.proto")}
+	b := &dpb.FileDescriptorProto{Name: proto.String("b.proto"), Dependency: []string{"a.proto"}}
+	c := &dpb.FileDescriptorProto{Name: proto.String("c.proto"), Dependency: []string{"a.proto", "b.proto"}}
+
+	srv := &serverReflectionServer{
+		extraSources: []DescriptorSource{&fakeDescriptorSource{
+			files: map[string]*dpb.FileDescriptorProto{"a.proto": a, "b.proto": b, "c.proto": c},
+		}},
+	}
+
+	got, err := srv.allFileDescriptors(c, map[string]bool{})
+	if err != nil {
+		t.Fatalf("allFileDescriptors: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("allFileDescriptors returned %d files, want 3", len(got))
+	}
+	for i, want := range []*dpb.FileDescriptorProto{a, b, c} {
+		fd := new(dpb.FileDescriptorProto)
+		if err := proto.Unmarshal(got[i], fd); err != nil {
+			t.Fatalf("unmarshal file %d: %v", i, err)
+		}
+		if fd.GetName() != want.GetName() {
+			t.Errorf("file %d = %q, want %q", i, fd.GetName(), want.GetName())
+		}
+	}
+}
+
+// TestAllFileDescriptorsCycle checks that a dependency cycle does not cause
+// an infinite loop.
+func TestAllFileDescriptorsCycle(t *testing.T) {
+	x := &dpb.FileDescriptorProto{Name: proto.String("x.proto"), Dependency: []string{"y.proto"}}
+	y := &dpb.FileDescriptorProto{Name: proto.String("y.proto"), Dependency: []string{"x.proto"}}
+
+	srv := &serverReflectionServer{
+		extraSources: []DescriptorSource{&fakeDescriptorSource{
+			files: map[string]*dpb.FileDescriptorProto{"x.proto": x, "y.proto": y},
+		}},
+	}
+
+	got, err := srv.allFileDescriptors(x, map[string]bool{})
+	if err != nil {
+		t.Fatalf("allFileDescriptors: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("allFileDescriptors returned %d files, want 2", len(got))
+	}
+}
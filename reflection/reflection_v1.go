@@ -0,0 +1,138 @@
+package reflection
+
+import (
+	rpbv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+)
+
+// v1ServerReflectionServer adapts a serverReflectionServer, which implements
+// the descriptor lookup logic in terms of the v1alpha message types, to the
+// stable grpc.reflection.v1.ServerReflection service. It converts requests
+// and responses on the wire rather than duplicating the lookup code.
+type v1ServerReflectionServer struct {
+	s *serverReflectionServer
+}
+
+func (v *v1ServerReflectionServer) ServerReflectionInfo(stream rpbv1.ServerReflection_ServerReflectionInfoServer) error {
+	return v.s.ServerReflectionInfo(&v1AlphaServerStream{stream})
+}
+
+// v1AlphaServerStream wraps a v1 ServerReflectionInfo stream so that it can
+// be passed to the v1alpha-typed serverReflectionServer.ServerReflectionInfo,
+// translating messages to and from the v1alpha wire types as they cross the
+// boundary.
+type v1AlphaServerStream struct {
+	rpbv1.ServerReflection_ServerReflectionInfoServer
+}
+
+func (a *v1AlphaServerStream) Send(resp *rpb.ServerReflectionResponse) error {
+	return a.ServerReflection_ServerReflectionInfoServer.Send(toV1Response(resp))
+}
+
+func (a *v1AlphaServerStream) Recv() (*rpb.ServerReflectionRequest, error) {
+	req, err := a.ServerReflection_ServerReflectionInfoServer.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return toV1AlphaRequest(req), nil
+}
+
+// toV1AlphaRequest converts a v1 ServerReflectionRequest to the equivalent
+// v1alpha message so it can be handled by the shared lookup logic.
+func toV1AlphaRequest(v1req *rpbv1.ServerReflectionRequest) *rpb.ServerReflectionRequest {
+	if v1req == nil {
+		return nil
+	}
+	out := &rpb.ServerReflectionRequest{
+		Host: v1req.Host,
+	}
+	switch mr := v1req.MessageRequest.(type) {
+	case *rpbv1.ServerReflectionRequest_FileByFilename:
+		out.MessageRequest = &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: mr.FileByFilename}
+	case *rpbv1.ServerReflectionRequest_FileContainingSymbol:
+		out.MessageRequest = &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: mr.FileContainingSymbol}
+	case *rpbv1.ServerReflectionRequest_FileContainingExtension:
+		out.MessageRequest = &rpb.ServerReflectionRequest_FileContainingExtension{
+			FileContainingExtension: &rpb.ExtensionRequest{
+				ContainingType:  mr.FileContainingExtension.GetContainingType(),
+				ExtensionNumber: mr.FileContainingExtension.GetExtensionNumber(),
+			},
+		}
+	case *rpbv1.ServerReflectionRequest_AllExtensionNumbersOfType:
+		out.MessageRequest = &rpb.ServerReflectionRequest_AllExtensionNumbersOfType{AllExtensionNumbersOfType: mr.AllExtensionNumbersOfType}
+	case *rpbv1.ServerReflectionRequest_ListServices:
+		out.MessageRequest = &rpb.ServerReflectionRequest_ListServices{ListServices: mr.ListServices}
+	}
+	return out
+}
+
+// toV1Response converts a v1alpha ServerReflectionResponse, as produced by
+// the shared lookup logic, to the equivalent v1 message.
+func toV1Response(v1alpharesp *rpb.ServerReflectionResponse) *rpbv1.ServerReflectionResponse {
+	if v1alpharesp == nil {
+		return nil
+	}
+	out := &rpbv1.ServerReflectionResponse{
+		ValidHost:       v1alpharesp.ValidHost,
+		OriginalRequest: toV1Request(v1alpharesp.OriginalRequest),
+	}
+	switch mr := v1alpharesp.MessageResponse.(type) {
+	case *rpb.ServerReflectionResponse_FileDescriptorResponse:
+		out.MessageResponse = &rpbv1.ServerReflectionResponse_FileDescriptorResponse{
+			FileDescriptorResponse: &rpbv1.FileDescriptorResponse{FileDescriptorProto: mr.FileDescriptorResponse.GetFileDescriptorProto()},
+		}
+	case *rpb.ServerReflectionResponse_AllExtensionNumbersResponse:
+		out.MessageResponse = &rpbv1.ServerReflectionResponse_AllExtensionNumbersResponse{
+			AllExtensionNumbersResponse: &rpbv1.ExtensionNumberResponse{
+				BaseTypeName:    mr.AllExtensionNumbersResponse.GetBaseTypeName(),
+				ExtensionNumber: mr.AllExtensionNumbersResponse.GetExtensionNumber(),
+			},
+		}
+	case *rpb.ServerReflectionResponse_ListServicesResponse:
+		svcs := make([]*rpbv1.ServiceResponse, len(mr.ListServicesResponse.GetService()))
+		for i, svc := range mr.ListServicesResponse.GetService() {
+			svcs[i] = &rpbv1.ServiceResponse{Name: svc.GetName()}
+		}
+		out.MessageResponse = &rpbv1.ServerReflectionResponse_ListServicesResponse{
+			ListServicesResponse: &rpbv1.ListServiceResponse{Service: svcs},
+		}
+	case *rpb.ServerReflectionResponse_ErrorResponse:
+		out.MessageResponse = &rpbv1.ServerReflectionResponse_ErrorResponse{
+			ErrorResponse: &rpbv1.ErrorResponse{
+				ErrorCode:    mr.ErrorResponse.GetErrorCode(),
+				ErrorMessage: mr.ErrorResponse.GetErrorMessage(),
+			},
+		}
+	}
+	return out
+}
+
+// toV1Request converts a v1alpha ServerReflectionRequest to the equivalent
+// v1 message, for embedding as the OriginalRequest on an outgoing v1
+// response.
+func toV1Request(v1alphareq *rpb.ServerReflectionRequest) *rpbv1.ServerReflectionRequest {
+	if v1alphareq == nil {
+		return nil
+	}
+	out := &rpbv1.ServerReflectionRequest{
+		Host: v1alphareq.Host,
+	}
+	switch mr := v1alphareq.MessageRequest.(type) {
+	case *rpb.ServerReflectionRequest_FileByFilename:
+		out.MessageRequest = &rpbv1.ServerReflectionRequest_FileByFilename{FileByFilename: mr.FileByFilename}
+	case *rpb.ServerReflectionRequest_FileContainingSymbol:
+		out.MessageRequest = &rpbv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: mr.FileContainingSymbol}
+	case *rpb.ServerReflectionRequest_FileContainingExtension:
+		out.MessageRequest = &rpbv1.ServerReflectionRequest_FileContainingExtension{
+			FileContainingExtension: &rpbv1.ExtensionRequest{
+				ContainingType:  mr.FileContainingExtension.GetContainingType(),
+				ExtensionNumber: mr.FileContainingExtension.GetExtensionNumber(),
+			},
+		}
+	case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
+		out.MessageRequest = &rpbv1.ServerReflectionRequest_AllExtensionNumbersOfType{AllExtensionNumbersOfType: mr.AllExtensionNumbersOfType}
+	case *rpb.ServerReflectionRequest_ListServices:
+		out.MessageRequest = &rpbv1.ServerReflectionRequest_ListServices{ListServices: mr.ListServices}
+	}
+	return out
+}
@@ -7,38 +7,154 @@ import (
 	"io"
 	"io/ioutil"
 	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/golang/protobuf/proto"
 	dpb "github.com/golang/protobuf/protoc-gen-go/descriptor"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
+	rpbv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
 	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 )
 
+// defaultCacheSize is the maximum number of entries retained in each of the
+// per-type descriptor caches when WithMaxCacheSize is not used.
+const defaultCacheSize = 1024
+
 type serverReflectionServer struct {
-	s *grpc.Server
-	// TODO mu is not used. Add lock() and unlock().
-	mu                sync.Mutex
-	typeToNameMap     map[reflect.Type]string
-	nameToTypeMap     map[string]reflect.Type
-	typeToFileDescMap map[reflect.Type]*dpb.FileDescriptorProto
+	s  *grpc.Server
+	mu sync.RWMutex
+	// typeToNameMap, nameToTypeMap, and typeToFileDescMap are bounded LRU
+	// caches guarded by mu; they are populated from arbitrary types and
+	// symbols seen across concurrent ServerReflectionInfo streams, so
+	// without a cap a long-lived server touching many distinct
+	// dynamically-generated types would grow them without bound.
+	typeToNameMap     *lru // reflect.Type -> string
+	nameToTypeMap     *lru // string -> reflect.Type
+	typeToFileDescMap *lru // reflect.Type -> *dpb.FileDescriptorProto
+	cacheSize         int
+	// extraSources are consulted, in the order given, whenever a lookup
+	// against the process-global protobuf registry comes up empty.
+	extraSources []DescriptorSource
+	// logger reports non-fatal errors, such as a failure to decompress an
+	// embedded file descriptor. It defaults to grpclog's package-level
+	// logger.
+	logger grpclog.LoggerV2
+}
+
+func (s *serverReflectionServer) warningf(format string, args ...interface{}) {
+	if s.logger != nil {
+		s.logger.Warningf(format, args...)
+		return
+	}
+	grpclog.Warningf(format, args...)
+}
+
+// DescriptorSource supplies file descriptors for the types, symbols, and
+// extensions a server knows about. The process-global protobuf registry is
+// always consulted, but servers that build their handlers from
+// FileDescriptorSet bytes at runtime (proxies, gateways, plugin-based
+// servers) have no entries there; such servers can implement
+// DescriptorSource and register it with WithDescriptorSource so reflection
+// works for their dynamically-registered types too.
+type DescriptorSource interface {
+	// FindSymbol returns the file descriptor proto declaring the given
+	// fully-qualified symbol (message, enum, service, or method name).
+	FindSymbol(name string) (*dpb.FileDescriptorProto, error)
+	// FindFileByName returns the file descriptor proto for the given
+	// filename.
+	FindFileByName(name string) (*dpb.FileDescriptorProto, error)
+	// FindExtension returns the file descriptor proto declaring the
+	// extension of msg identified by field number.
+	FindExtension(msg string, field int32) (*dpb.FileDescriptorProto, error)
+	// AllExtensionNumbersForType returns all known extension numbers for
+	// msg.
+	AllExtensionNumbersForType(msg string) ([]int32, error)
 }
 
-// InstallOnServer installs server reflection service on the given grpc server.
+// ServerOption configures optional behavior of the reflection service
+// installed by Register.
+type ServerOption func(*serverReflectionServer)
+
+// WithDescriptorSource appends src to the list of descriptor sources
+// consulted when a type, symbol, or extension is not found in the
+// process-global protobuf registry. Sources are tried in the order they are
+// added.
+func WithDescriptorSource(src DescriptorSource) ServerOption {
+	return func(s *serverReflectionServer) {
+		s.extraSources = append(s.extraSources, src)
+	}
+}
+
+// WithMaxCacheSize overrides the default 1024-entry cap on each of the
+// per-type descriptor caches. A size of 0 means unbounded.
+func WithMaxCacheSize(size int) ServerOption {
+	return func(s *serverReflectionServer) {
+		s.cacheSize = size
+	}
+}
+
+// WithLogger overrides the logger used to report non-fatal errors, such as
+// a failure to decompress an embedded file descriptor, for callers that
+// route their logs through something other than grpclog (e.g. zap,
+// zerolog).
+func WithLogger(logger grpclog.LoggerV2) ServerOption {
+	return func(s *serverReflectionServer) {
+		s.logger = logger
+	}
+}
+
+// Register installs the stable grpc.reflection.v1.ServerReflection service
+// and the older grpc.reflection.v1alpha.ServerReflection service on s, both
+// served from the same underlying descriptor lookup logic. By default,
+// types are looked up in the process-global protobuf registry; opts can
+// supply additional DescriptorSources for servers that register
+// dynamically-built handlers.
+func Register(s *grpc.Server, opts ...ServerOption) {
+	srv := &serverReflectionServer{
+		s:         s,
+		cacheSize: defaultCacheSize,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	srv.typeToNameMap = newLRU(srv.cacheSize)
+	srv.nameToTypeMap = newLRU(srv.cacheSize)
+	srv.typeToFileDescMap = newLRU(srv.cacheSize)
+
+	rpb.RegisterServerReflectionServer(s, srv)
+	rpbv1.RegisterServerReflectionServer(s, &v1ServerReflectionServer{s: srv})
+}
+
+// InstallOnServer installs server reflection service on the given grpc
+// server. It is equivalent to calling Register with no options.
 func InstallOnServer(s *grpc.Server) {
-	rpb.RegisterServerReflectionServer(s, &serverReflectionServer{
-		s:                 s,
-		typeToNameMap:     make(map[reflect.Type]string),
-		nameToTypeMap:     make(map[string]reflect.Type),
-		typeToFileDescMap: make(map[reflect.Type]*dpb.FileDescriptorProto),
-	})
+	Register(s)
 }
 
 type protoMessage interface {
 	Descriptor() ([]byte, []int)
 }
 
+// cacheLookup checks c for key using a read lock for the common case and
+// only takes the exclusive lock to promote a hit's recency, so that two
+// concurrent hits never race on the LRU's backing list (peek doesn't touch
+// it; the mutating get does, and only ever runs under Lock).
+func (s *serverReflectionServer) cacheLookup(c *lru, key interface{}) (interface{}, bool) {
+	s.mu.RLock()
+	v, ok := c.peek(key)
+	s.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	s.mu.Lock()
+	c.get(key)
+	s.mu.Unlock()
+	return v, true
+}
+
 func (s *serverReflectionServer) fileDescForType(st reflect.Type) (*dpb.FileDescriptorProto, []int, error) {
 	// Indexes list is not stored in cache.
 	// So this step is needed to get idxs.
@@ -48,9 +164,8 @@ func (s *serverReflectionServer) fileDescForType(st reflect.Type) (*dpb.FileDesc
 	}
 	enc, idxs := m.Descriptor()
 
-	// Check type to fileDesc cache.
-	if fd, ok := s.typeToFileDescMap[st]; ok {
-		return fd, idxs, nil
+	if v, ok := s.cacheLookup(s.typeToFileDescMap, st); ok {
+		return v.(*dpb.FileDescriptorProto), idxs, nil
 	}
 
 	// Cache missed, try to decode.
@@ -59,41 +174,63 @@ func (s *serverReflectionServer) fileDescForType(st reflect.Type) (*dpb.FileDesc
 		return nil, nil, err
 	}
 	// Add to cache.
-	s.typeToFileDescMap[st] = fd
+	s.mu.Lock()
+	s.typeToFileDescMap.add(st, fd)
+	s.mu.Unlock()
 	return fd, idxs, nil
 }
 
+// fileDescDecodeError marks an error as coming from decoding an embedded
+// file descriptor (bad gzip, bad wire format) rather than from failing to
+// find a symbol, file, or extension, so that ServerReflectionInfo can report
+// it as codes.Internal instead of codes.NotFound.
+type fileDescDecodeError struct {
+	err error
+}
+
+func (e *fileDescDecodeError) Error() string { return e.err.Error() }
+
+// errorCode picks the status code reported to the client for a lookup
+// failure: codes.Internal for a corrupt embedded descriptor, codes.NotFound
+// for everything else (unknown file, symbol, or extension).
+func errorCode(err error) codes.Code {
+	if _, ok := err.(*fileDescDecodeError); ok {
+		return codes.Internal
+	}
+	return codes.NotFound
+}
+
 func (s *serverReflectionServer) decodeFileDesc(enc []byte) (*dpb.FileDescriptorProto, error) {
-	raw := decompress(enc)
-	if raw == nil {
-		return nil, fmt.Errorf("failed to decompress enc")
+	raw, err := s.decompress(enc)
+	if err != nil {
+		return nil, &fileDescDecodeError{fmt.Errorf("failed to decompress enc: %v", err)}
 	}
 
 	fd := new(dpb.FileDescriptorProto)
 	if err := proto.Unmarshal(raw, fd); err != nil {
-		return nil, fmt.Errorf("bad descriptor: %v", err)
+		return nil, &fileDescDecodeError{fmt.Errorf("bad descriptor: %v", err)}
 	}
 	return fd, nil
 }
 
-func decompress(b []byte) []byte {
+func (s *serverReflectionServer) decompress(b []byte) ([]byte, error) {
 	r, err := gzip.NewReader(bytes.NewReader(b))
 	if err != nil {
-		fmt.Printf("bad gzipped descriptor: %v\n", err)
-		return nil
+		s.warningf("reflection: failed to create gzip reader for embedded descriptor: %v", err)
+		return nil, err
 	}
 	out, err := ioutil.ReadAll(r)
 	if err != nil {
-		fmt.Printf("bad gzipped descriptor: %v\n", err)
-		return nil
+		s.warningf("reflection: failed to decompress embedded descriptor: %v", err)
+		return nil, err
 	}
-	return out
+	return out, nil
 }
 
 func (s *serverReflectionServer) typeForName(name string) (reflect.Type, error) {
 	// Check cache first.
-	if st, ok := s.nameToTypeMap[name]; ok {
-		return st, nil
+	if v, ok := s.cacheLookup(s.nameToTypeMap, name); ok {
+		return v.(reflect.Type), nil
 	}
 
 	pt := proto.MessageType(name)
@@ -103,8 +240,10 @@ func (s *serverReflectionServer) typeForName(name string) (reflect.Type, error)
 	st := pt.Elem()
 
 	// Add to cache.
-	s.typeToNameMap[st] = name
-	s.nameToTypeMap[name] = st
+	s.mu.Lock()
+	s.typeToNameMap.add(st, name)
+	s.nameToTypeMap.add(name, st)
+	s.mu.Unlock()
 
 	// TODO is this necessary?
 	// In most cases, the returned type will be used to search
@@ -112,7 +251,9 @@ func (s *serverReflectionServer) typeForName(name string) (reflect.Type, error)
 	// Add it to cache now.
 	fd, _, err := s.fileDescForType(st)
 	if err == nil {
-		s.typeToFileDescMap[st] = fd
+		s.mu.Lock()
+		s.typeToFileDescMap.add(st, fd)
+		s.mu.Unlock()
 	}
 
 	return st, nil
@@ -139,8 +280,8 @@ func (s *serverReflectionServer) fileDescContainingExtension(st reflect.Type, ex
 	extT := reflect.TypeOf(extDesc.ExtensionType).Elem()
 	// TODO this doesn't work if extT is simple types, like int32
 	// Check cache.
-	if fd, ok := s.typeToFileDescMap[extT]; ok {
-		return fd, nil
+	if v, ok := s.cacheLookup(s.typeToFileDescMap, extT); ok {
+		return v.(*dpb.FileDescriptorProto), nil
 	}
 
 	fd, _, err := s.fileDescForType(extT)
@@ -163,82 +304,139 @@ func (s *serverReflectionServer) allExtensionNumbersForType(st reflect.Type) ([]
 	return out, nil
 }
 
-func (s *serverReflectionServer) fileDescWireFormatByFilename(name string) ([]byte, error) {
-	enc := proto.FileDescriptor(name)
-	if enc == nil {
-		return nil, fmt.Errorf("unknown file: %v", name)
+// allFileDescriptors marshals fd and every file it transitively imports (via
+// GetDependency) to wire format, in dependency order, so that a client can
+// reconstruct the full descriptor graph from a single response without
+// issuing a FileByFilename round trip per import. seen is keyed by filename
+// and is shared across the recursion to dedupe files reachable through
+// multiple paths.
+func (s *serverReflectionServer) allFileDescriptors(fd *dpb.FileDescriptorProto, seen map[string]bool) ([][]byte, error) {
+	if seen[fd.GetName()] {
+		return nil, nil
 	}
-	fd, err := s.decodeFileDesc(enc)
+	seen[fd.GetName()] = true
+
+	var r [][]byte
+	for _, dep := range fd.GetDependency() {
+		if seen[dep] {
+			continue
+		}
+		// Resolve through fileDescByName, not proto.FileDescriptor
+		// directly, so that a dependency only known to an extra
+		// DescriptorSource (e.g. a dynamically-loaded FileDescriptorSet)
+		// is still found instead of failing the whole closure.
+		depFd, err := s.fileDescByName(dep)
+		if err != nil {
+			return nil, err
+		}
+		depR, err := s.allFileDescriptors(depFd, seen)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, depR...)
+	}
+
+	b, err := proto.Marshal(fd)
 	if err != nil {
 		return nil, err
 	}
-	b, err := proto.Marshal(fd)
+	return append(r, b), nil
+}
+
+func (s *serverReflectionServer) fileDescWireFormatByFilename(name string) ([][]byte, error) {
+	fd, err := s.fileDescByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.allFileDescriptors(fd, map[string]bool{})
+}
+
+func (s *serverReflectionServer) fileDescByName(name string) (*dpb.FileDescriptorProto, error) {
+	enc := proto.FileDescriptor(name)
+	if enc != nil {
+		return s.decodeFileDesc(enc)
+	}
+	for _, src := range s.extraSources {
+		if fd, err := src.FindFileByName(name); err == nil && fd != nil {
+			return fd, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown file: %v", name)
+}
+
+func (s *serverReflectionServer) fileDescWireFormatContainingSymbol(name string) ([][]byte, error) {
+	fd, err := s.fileDescContainingSymbol(name)
 	if err != nil {
 		return nil, err
 	}
-	return b, nil
+	return s.allFileDescriptors(fd, map[string]bool{})
 }
 
-func (s *serverReflectionServer) fileDescWireFormatContainingSymbol(name string) ([]byte, error) {
-	var (
-		fd *dpb.FileDescriptorProto
-	)
+func (s *serverReflectionServer) fileDescContainingSymbol(name string) (*dpb.FileDescriptorProto, error) {
 	// Check if it's a type name.
 	if st, err := s.typeForName(name); err == nil {
-		fd, _, err = s.fileDescForType(st)
+		fd, _, err := s.fileDescForType(st)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		// Check if it's a service name or method name.
-		meta := s.s.Metadata(name)
-		if meta != nil {
-			if enc, ok := meta.([]byte); ok {
-				fd, err = s.decodeFileDesc(enc)
-				if err != nil {
-					return nil, err
-				}
+		return fd, nil
+	}
+
+	// Check if it's a service name or method name.
+	if meta := s.s.Metadata(name); meta != nil {
+		if enc, ok := meta.([]byte); ok {
+			fd, err := s.decodeFileDesc(enc)
+			if err != nil {
+				return nil, err
 			}
+			return fd, nil
 		}
 	}
 
-	// Marshal to wire format.
-	if fd != nil {
-		b, err := proto.Marshal(fd)
-		if err != nil {
-			return nil, err
+	for _, src := range s.extraSources {
+		if fd, err := src.FindSymbol(name); err == nil && fd != nil {
+			return fd, nil
 		}
-		return b, nil
 	}
 	return nil, fmt.Errorf("unknown symbol: %v", name)
 }
 
-func (s *serverReflectionServer) fileDescWireFormatContainingExtension(typeName string, extNum int32) ([]byte, error) {
-	st, err := s.typeForName(typeName)
+func (s *serverReflectionServer) fileDescWireFormatContainingExtension(typeName string, extNum int32) ([][]byte, error) {
+	fd, err := s.fileDescContainingExtensionByName(typeName, extNum)
 	if err != nil {
 		return nil, err
 	}
-	fd, err := s.fileDescContainingExtension(st, extNum)
-	if err != nil {
-		return nil, err
+	return s.allFileDescriptors(fd, map[string]bool{})
+}
+
+func (s *serverReflectionServer) fileDescContainingExtensionByName(typeName string, extNum int32) (*dpb.FileDescriptorProto, error) {
+	if st, err := s.typeForName(typeName); err == nil {
+		fd, err := s.fileDescContainingExtension(st, extNum)
+		if err == nil {
+			return fd, nil
+		}
+		if _, ok := err.(*fileDescDecodeError); ok {
+			return nil, err
+		}
 	}
-	b, err := proto.Marshal(fd)
-	if err != nil {
-		return nil, err
+	for _, src := range s.extraSources {
+		if fd, err := src.FindExtension(typeName, extNum); err == nil && fd != nil {
+			return fd, nil
+		}
 	}
-	return b, nil
+	return nil, fmt.Errorf("failed to find registered extension for extension number %v of type %v", extNum, typeName)
 }
 
 func (s *serverReflectionServer) allExtensionNumbersForTypeName(name string) ([]int32, error) {
-	st, err := s.typeForName(name)
-	if err != nil {
-		return nil, err
+	if st, err := s.typeForName(name); err == nil {
+		return s.allExtensionNumbersForType(st)
 	}
-	extNums, err := s.allExtensionNumbersForType(st)
-	if err != nil {
-		return nil, err
+	for _, src := range s.extraSources {
+		if extNums, err := src.AllExtensionNumbersForType(name); err == nil {
+			return extNums, nil
+		}
 	}
-	return extNums, nil
+	return nil, fmt.Errorf("unknown type: %q", name)
 }
 
 func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflection_ServerReflectionInfoServer) error {
@@ -261,13 +459,13 @@ func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflectio
 			if err != nil {
 				out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
 					ErrorResponse: &rpb.ErrorResponse{
-						ErrorCode:    int32(codes.NotFound),
+						ErrorCode:    int32(errorCode(err)),
 						ErrorMessage: err.Error(),
 					},
 				}
 			} else {
 				out.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{
-					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: [][]byte{b}},
+					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: b},
 				}
 			}
 		case *rpb.ServerReflectionRequest_FileContainingSymbol:
@@ -275,13 +473,13 @@ func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflectio
 			if err != nil {
 				out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
 					ErrorResponse: &rpb.ErrorResponse{
-						ErrorCode:    int32(codes.NotFound),
+						ErrorCode:    int32(errorCode(err)),
 						ErrorMessage: err.Error(),
 					},
 				}
 			} else {
 				out.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{
-					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: [][]byte{b}},
+					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: b},
 				}
 			}
 		case *rpb.ServerReflectionRequest_FileContainingExtension:
@@ -291,13 +489,13 @@ func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflectio
 			if err != nil {
 				out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
 					ErrorResponse: &rpb.ErrorResponse{
-						ErrorCode:    int32(codes.NotFound),
+						ErrorCode:    int32(errorCode(err)),
 						ErrorMessage: err.Error(),
 					},
 				}
 			} else {
 				out.MessageResponse = &rpb.ServerReflectionResponse_FileDescriptorResponse{
-					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: [][]byte{b}},
+					FileDescriptorResponse: &rpb.FileDescriptorResponse{FileDescriptorProto: b},
 				}
 			}
 		case *rpb.ServerReflectionRequest_AllExtensionNumbersOfType:
@@ -305,7 +503,7 @@ func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflectio
 			if err != nil {
 				out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
 					ErrorResponse: &rpb.ErrorResponse{
-						ErrorCode:    int32(codes.NotFound),
+						ErrorCode:    int32(errorCode(err)),
 						ErrorMessage: err.Error(),
 					},
 				}
@@ -318,10 +516,18 @@ func (s *serverReflectionServer) ServerReflectionInfo(stream rpb.ServerReflectio
 				}
 			}
 		case *rpb.ServerReflectionRequest_ListServices:
-			out.MessageResponse = &rpb.ServerReflectionResponse_ErrorResponse{
-				ErrorResponse: &rpb.ErrorResponse{
-					ErrorCode:    int32(codes.Unimplemented),
-					ErrorMessage: "list_services not implemented",
+			svcNames := make([]string, 0, len(s.s.GetServiceInfo()))
+			for name := range s.s.GetServiceInfo() {
+				svcNames = append(svcNames, name)
+			}
+			sort.Strings(svcNames)
+			serviceResponses := make([]*rpb.ServiceResponse, len(svcNames))
+			for i, name := range svcNames {
+				serviceResponses[i] = &rpb.ServiceResponse{Name: name}
+			}
+			out.MessageResponse = &rpb.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &rpb.ListServiceResponse{
+					Service: serviceResponses,
 				},
 			}
 		default: